@@ -0,0 +1,298 @@
+// bandwidth.go
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MaxRate is the BytesPerSec sentinel meaning "unlimited" - no throttling is
+// applied to a connection configured with it.
+const MaxRate = -1
+
+// tlsHandshakeTimeout bounds how long Accept waits for a client's TLS
+// handshake before giving up and serving the connection at the default
+// rate, so a stalling client can't freeze the whole listener.
+const tlsHandshakeTimeout = 5 * time.Second
+
+// BandwidthConfig configures the bandwidth-throttling server entrypoint.
+type BandwidthConfig struct {
+	DefaultBytesPerSec int `json:"DefaultBytesPerSec"` // applied until a client-specific rate is known
+}
+
+// bandwidthBucket is a token bucket limiting throughput to ratePerSec bytes
+// per second, used on one direction (Read or Write) of a single connection.
+type bandwidthBucket struct {
+	mu      sync.Mutex
+	rate    int64 // bytes/sec; MaxRate means unlimited
+	tokens  float64
+	lastFed time.Time
+}
+
+func newBandwidthBucket(ratePerSec int) *bandwidthBucket {
+	return &bandwidthBucket{rate: int64(ratePerSec), tokens: float64(ratePerSec), lastFed: time.Now()}
+}
+
+// setRate changes the bucket's rate, e.g. once a client's BytesPerSec is
+// resolved after the connection was already accepted at the default rate.
+func (b *bandwidthBucket) setRate(ratePerSec int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = int64(ratePerSec)
+}
+
+// wait blocks until n bytes' worth of tokens are available, consuming them.
+func (b *bandwidthBucket) wait(n int) {
+	for {
+		b.mu.Lock()
+		if b.rate == MaxRate || b.rate <= 0 {
+			b.mu.Unlock()
+			return
+		}
+
+		// Let the bucket hold up to n tokens when n exceeds one second's
+		// worth, so a single large read or write can still be satisfied.
+		capacity := float64(b.rate)
+		if float64(n) > capacity {
+			capacity = float64(n)
+		}
+
+		now := time.Now()
+		b.tokens += now.Sub(b.lastFed).Seconds() * float64(b.rate)
+		if b.tokens > capacity {
+			b.tokens = capacity
+		}
+		b.lastFed = now
+
+		if b.tokens >= float64(n) {
+			b.tokens -= float64(n)
+			b.mu.Unlock()
+			return
+		}
+
+		sleepFor := time.Duration((float64(n) - b.tokens) / float64(b.rate) * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(sleepFor)
+	}
+}
+
+// slowConn wraps a net.Conn, throttling Read/Write to a bytes/sec rate and
+// tracking cumulative byte counts for the /metrics endpoint.
+type slowConn struct {
+	net.Conn
+	listener     *SlowListener
+	readBucket   *bandwidthBucket
+	writeBucket  *bandwidthBucket
+	bytesRead    int64 // atomic
+	bytesWritten int64 // atomic
+}
+
+func newSlowConn(conn net.Conn, ratePerSec int, listener *SlowListener) *slowConn {
+	return &slowConn{
+		Conn:        conn,
+		listener:    listener,
+		readBucket:  newBandwidthBucket(ratePerSec),
+		writeBucket: newBandwidthBucket(ratePerSec),
+	}
+}
+
+// Close implements net.Conn, additionally removing this connection from its
+// listener's tracking map so a long-lived server doesn't accumulate one
+// entry per connection ever accepted.
+func (c *slowConn) Close() error {
+	err := c.Conn.Close()
+	if c.listener != nil {
+		c.listener.forget(c.Conn, c)
+	}
+	return err
+}
+
+func (c *slowConn) setRate(ratePerSec int) {
+	c.readBucket.setRate(ratePerSec)
+	c.writeBucket.setRate(ratePerSec)
+}
+
+// Read implements net.Conn, throttling after each underlying read so large
+// reads are still metered against the bucket.
+func (c *slowConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.readBucket.wait(n)
+		atomic.AddInt64(&c.bytesRead, int64(n))
+	}
+	return n, err
+}
+
+// Write implements net.Conn, throttling before the underlying write so an
+// abusive client's large download can't burst past its configured rate.
+func (c *slowConn) Write(p []byte) (int, error) {
+	c.writeBucket.wait(len(p))
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.bytesWritten, int64(n))
+	return n, err
+}
+
+// SlowListener wraps a net.Listener so every accepted connection's Read and
+// Write calls are throttled to a per-client bytes/sec rate - useful for
+// large uploads/downloads where request-count limiting is the wrong tool,
+// since an abusive client sees slow I/O rather than a 429.
+type SlowListener struct {
+	net.Listener
+	defaultRate int
+
+	mu          sync.Mutex
+	conns       map[net.Conn]*slowConn
+	closedRead  int64 // atomic; bytesRead folded in from conns removed on Close
+	closedWrite int64 // atomic; bytesWritten folded in from conns removed on Close
+}
+
+// NewSlowListener wraps inner, applying defaultBytesPerSec until a
+// connection's client-specific rate is resolved.
+func NewSlowListener(inner net.Listener, defaultBytesPerSec int) *SlowListener {
+	return &SlowListener{
+		Listener:    inner,
+		defaultRate: defaultBytesPerSec,
+		conns:       make(map[net.Conn]*slowConn),
+	}
+}
+
+// forget removes conn's entry once it closes, folding its final byte counts
+// into the listener's running totals so Counters keeps reporting the sum
+// across every connection ever accepted without conns growing without bound
+// for the life of the process.
+func (l *SlowListener) forget(conn net.Conn, sc *slowConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, conn)
+	atomic.AddInt64(&l.closedRead, atomic.LoadInt64(&sc.bytesRead))
+	atomic.AddInt64(&l.closedWrite, atomic.LoadInt64(&sc.bytesWritten))
+}
+
+// Accept implements net.Listener. For TLS connections, the client cert's CN
+// is used to look up a per-client BytesPerSec as soon as the handshake
+// completes (bounded by tlsHandshakeTimeout, so a stalling client can't
+// block the accept loop for longer than that); for plaintext connections, the default rate
+// applies until IdentifyClient is called once an HTTP handler identifies
+// the client.
+func (l *SlowListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	rate := l.defaultRate
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		err := tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
+		if err == nil {
+			if cn := clientCNFromState(tlsConn.ConnectionState()); cn != "" {
+				rate = l.rateForClient(cn)
+			}
+		}
+	}
+
+	sc := newSlowConn(conn, rate, l)
+	l.mu.Lock()
+	l.conns[conn] = sc
+	l.mu.Unlock()
+	return sc, nil
+}
+
+// IdentifyClient re-applies conn's rate once clientID has been identified by
+// an HTTP handler (e.g. from the X-Client-ID header via identifyClient),
+// for connections that arrived without a usable TLS client cert. conn must
+// be the *slowConn Accept produced, e.g. as retrieved from an
+// http.Server.ConnContext-stashed context value; any other net.Conn is a
+// no-op.
+func (l *SlowListener) IdentifyClient(conn net.Conn, clientID string) {
+	sc, ok := conn.(*slowConn)
+	if !ok {
+		return
+	}
+	sc.setRate(l.rateForClient(clientID))
+}
+
+func (l *SlowListener) rateForClient(clientID string) int {
+	config, err := LoadConfig()
+	if err != nil {
+		return l.defaultRate
+	}
+	for _, cc := range config.Clients {
+		if cc.ID == clientID && cc.BytesPerSec != 0 {
+			return cc.BytesPerSec
+		}
+	}
+	return l.defaultRate
+}
+
+func clientCNFromState(state tls.ConnectionState) string {
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+// Counters returns the bytes read and written summed across every
+// connection the listener has ever accepted, for the /metrics endpoint.
+func (l *SlowListener) Counters() (read, written int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	read = atomic.LoadInt64(&l.closedRead)
+	written = atomic.LoadInt64(&l.closedWrite)
+	for _, sc := range l.conns {
+		read += atomic.LoadInt64(&sc.bytesRead)
+		written += atomic.LoadInt64(&sc.bytesWritten)
+	}
+	return read, written
+}
+
+// connContextKey is the http.Server.ConnContext key under which the
+// accepted net.Conn (a *slowConn, once wrapped by SlowListener) is stashed,
+// so identifyClient can resolve it back from the request.
+type connContextKey struct{}
+
+// identifyClient wraps next so that, once a request reveals its client ID
+// via clientIDHeader, listener switches that connection from the default
+// rate to the client's configured BytesPerSec - the plaintext counterpart
+// to the TLS client-cert CN lookup in Accept.
+func identifyClient(listener *SlowListener, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientID := r.Header.Get(clientIDHeader); clientID != "" {
+			if conn, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+				listener.IdentifyClient(conn, clientID)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeSlow runs handler on listener, throttling every accepted connection's
+// Read/Write to its configured bytes/sec rate. Splitting this out from
+// ListenAndServeSlow lets a caller hold onto listener - e.g. to register its
+// Counters() against /metrics - before the (blocking) accept loop starts.
+func ServeSlow(listener *SlowListener, handler http.Handler) error {
+	server := &http.Server{
+		Handler: identifyClient(listener, handler),
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey{}, c)
+		},
+	}
+	return server.Serve(listener)
+}
+
+// ListenAndServeSlow is an alternative to http.ListenAndServe that throttles
+// bytes/second per connection via a SlowListener, instead of enforcing the
+// request-count limits handler applies on top.
+func ListenAndServeSlow(addr string, handler http.Handler, defaultBytesPerSec int) error {
+	inner, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return ServeSlow(NewSlowListener(inner, defaultBytesPerSec), handler)
+}
@@ -0,0 +1,61 @@
+// bandwidth_test.go
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSlowListener_ForgetsClosedConns(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	inner := &singleConnListener{conn: server}
+	l := NewSlowListener(inner, 1024)
+
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+
+	if got := len(l.conns); got != 1 {
+		t.Fatalf("expected 1 tracked conn after Accept, got %d", got)
+	}
+
+	go func() {
+		buf := make([]byte, 2)
+		client.Read(buf)
+	}()
+	if _, err := accepted.Write([]byte("hi")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := accepted.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got := len(l.conns); got != 0 {
+		t.Fatalf("expected the closed conn to be forgotten, got %d still tracked", got)
+	}
+
+	if read, written := l.Counters(); written < 2 {
+		t.Errorf("expected Counters to still reflect bytes written before close, got read=%d written=%d", read, written)
+	}
+}
+
+// singleConnListener is a net.Listener that yields conn once, then blocks,
+// so SlowListener.Accept has something to wrap without a real socket.
+type singleConnListener struct {
+	conn   net.Conn
+	served bool
+}
+
+func (s *singleConnListener) Accept() (net.Conn, error) {
+	if s.served {
+		select {}
+	}
+	s.served = true
+	return s.conn, nil
+}
+
+func (s *singleConnListener) Close() error   { return nil }
+func (s *singleConnListener) Addr() net.Addr { return s.conn.LocalAddr() }
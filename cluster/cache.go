@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+)
+
+// DecisionCache briefly caches an owner's CheckResponse on a non-owner node,
+// so a burst of requests for the same key doesn't round-trip to the owner
+// for every single one.
+type DecisionCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	resp    CheckResponse
+	expires time.Time
+}
+
+// NewDecisionCache creates a DecisionCache that holds entries for ttl.
+func NewDecisionCache(ttl time.Duration) *DecisionCache {
+	return &DecisionCache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// Get returns the cached CheckResponse for key, if present and unexpired.
+func (c *DecisionCache) Get(key string) (CheckResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return CheckResponse{}, false
+	}
+	return entry.resp, true
+}
+
+// Set stores resp for key until the cache's ttl elapses.
+func (c *DecisionCache) Set(key string, resp CheckResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{resp: resp, expires: time.Now().Add(c.ttl)}
+}
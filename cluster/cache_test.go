@@ -0,0 +1,30 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecisionCache_GetSetAndExpiry(t *testing.T) {
+	c := NewDecisionCache(10 * time.Millisecond)
+
+	if _, ok := c.Get("key"); ok {
+		t.Fatal("expected a miss on an empty cache")
+	}
+
+	resp := CheckResponse{Limited: true, Limit: 5, Remaining: 0}
+	c.Set("key", resp)
+
+	got, ok := c.Get("key")
+	if !ok {
+		t.Fatal("expected a hit right after Set")
+	}
+	if got != resp {
+		t.Errorf("expected %+v, got %+v", resp, got)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("key"); ok {
+		t.Fatal("expected the entry to have expired")
+	}
+}
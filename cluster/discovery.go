@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// Discoverer resolves the current set of cluster peers. Implementations may
+// be backed by static config, DNS, or a platform's service registry.
+type Discoverer interface {
+	Discover() ([]*Peer, error)
+}
+
+// PeerConfig is the static, config-file representation of a peer.
+type PeerConfig struct {
+	ID   string `json:"ID"`
+	Addr string `json:"Addr"`
+}
+
+// StaticDiscoverer returns a fixed peer list, as configured in the "Peers"
+// list of config.json's "cluster" section.
+type StaticDiscoverer struct {
+	Peers []PeerConfig
+}
+
+// Discover implements Discoverer.
+func (d StaticDiscoverer) Discover() ([]*Peer, error) {
+	peers := make([]*Peer, 0, len(d.Peers))
+	for _, pc := range d.Peers {
+		peers = append(peers, &Peer{ID: pc.ID, Addr: pc.Addr})
+	}
+	return peers, nil
+}
+
+// DNSSRVDiscoverer resolves peers from a DNS SRV record, e.g. one managed by
+// a headless Kubernetes Service or a Consul DNS interface.
+type DNSSRVDiscoverer struct {
+	Service string // SRV service name, e.g. "ratelimiter"
+	Proto   string // SRV proto, e.g. "tcp"
+	Domain  string // domain to query, e.g. "ratelimiter.default.svc.cluster.local"
+
+	Resolver interface {
+		LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	}
+}
+
+// Discover implements Discoverer by resolving the configured SRV record.
+func (d DNSSRVDiscoverer) Discover() ([]*Peer, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	_, records, err := resolver.LookupSRV(context.Background(), d.Service, d.Proto, d.Domain)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: SRV lookup for %s failed: %w", d.Domain, err)
+	}
+
+	peers := make([]*Peer, 0, len(records))
+	for _, rec := range records {
+		addr := fmt.Sprintf("%s:%d", rec.Target, rec.Port)
+		peers = append(peers, &Peer{ID: addr, Addr: addr})
+	}
+	return peers, nil
+}
+
+// K8sEndpointsWatcher discovers peers from the Endpoints of a Kubernetes
+// Service, refreshed via WatchFunc (wired to client-go's Informer in
+// production; kept as an injected function here to avoid a hard dependency
+// on client-go from this package).
+type K8sEndpointsWatcher struct {
+	Namespace string
+	Service   string
+	Port      int
+
+	// WatchFunc returns the current set of ready pod IPs backing the
+	// Service, and is expected to block waiting for the next change.
+	WatchFunc func(namespace, service string) ([]string, error)
+}
+
+// Discover implements Discoverer.
+func (w K8sEndpointsWatcher) Discover() ([]*Peer, error) {
+	if w.WatchFunc == nil {
+		return nil, fmt.Errorf("cluster: K8sEndpointsWatcher has no WatchFunc configured")
+	}
+
+	ips, err := w.WatchFunc(w.Namespace, w.Service)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: endpoints watch for %s/%s failed: %w", w.Namespace, w.Service, err)
+	}
+
+	peers := make([]*Peer, 0, len(ips))
+	for _, ip := range ips {
+		addr := fmt.Sprintf("%s:%d", ip, w.Port)
+		peers = append(peers, &Peer{ID: addr, Addr: addr})
+	}
+	return peers, nil
+}
@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Peer is one member of the cluster, identified by ID and reachable at Addr
+// (host:port, serving the forwarding HTTP API from rpc.go).
+type Peer struct {
+	ID   string
+	Addr string
+
+	healthy int32 // accessed atomically; 1 = healthy, 0 = unhealthy
+}
+
+// Healthy reports whether the most recent health check for p succeeded.
+func (p *Peer) Healthy() bool {
+	return atomic.LoadInt32(&p.healthy) == 1
+}
+
+func (p *Peer) setHealthy(ok bool) {
+	if ok {
+		atomic.StoreInt32(&p.healthy, 1)
+	} else {
+		atomic.StoreInt32(&p.healthy, 0)
+	}
+}
+
+// Pool maintains a Ring over a set of Peers and periodically health-checks
+// them, removing unhealthy peers from ownership so keys fail over to the
+// next peer on the ring.
+type Pool struct {
+	ring          *Ring
+	httpClient    *http.Client
+	checkInterval time.Duration
+	checkTimeout  time.Duration
+
+	mu    sync.Mutex
+	all   []*Peer
+	stopc chan struct{}
+}
+
+// NewPool creates a Pool over the given peers and starts health-checking
+// them at checkInterval. Call Stop to release resources.
+func NewPool(peers []*Peer, checkInterval, checkTimeout time.Duration) *Pool {
+	p := &Pool{
+		ring:          NewRing(),
+		httpClient:    &http.Client{Timeout: checkTimeout},
+		checkInterval: checkInterval,
+		checkTimeout:  checkTimeout,
+		all:           peers,
+		stopc:         make(chan struct{}),
+	}
+	for _, peer := range peers {
+		peer.setHealthy(true)
+	}
+	p.rebuildRing()
+	go p.healthCheckLoop()
+	return p
+}
+
+// Stop halts the background health-check loop.
+func (p *Pool) Stop() {
+	close(p.stopc)
+}
+
+// Ring returns the pool's current consistent-hash ring over healthy peers.
+func (p *Pool) Ring() *Ring {
+	return p.ring
+}
+
+// SetPeers replaces the pool's peer set, e.g. after a discovery refresh.
+func (p *Pool) SetPeers(peers []*Peer) {
+	p.mu.Lock()
+	for _, peer := range peers {
+		peer.setHealthy(true)
+	}
+	p.all = peers
+	p.mu.Unlock()
+	p.rebuildRing()
+}
+
+func (p *Pool) rebuildRing() {
+	p.mu.Lock()
+	healthy := make([]*Peer, 0, len(p.all))
+	for _, peer := range p.all {
+		if peer.Healthy() {
+			healthy = append(healthy, peer)
+		}
+	}
+	p.mu.Unlock()
+	p.ring.Set(healthy)
+}
+
+func (p *Pool) healthCheckLoop() {
+	ticker := time.NewTicker(p.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopc:
+			return
+		case <-ticker.C:
+			p.checkAll()
+		}
+	}
+}
+
+func (p *Pool) checkAll() {
+	p.mu.Lock()
+	peers := append([]*Peer(nil), p.all...)
+	p.mu.Unlock()
+
+	changed := false
+	for _, peer := range peers {
+		wasHealthy := peer.Healthy()
+		ok := p.ping(peer)
+		peer.setHealthy(ok)
+		if ok != wasHealthy {
+			changed = true
+		}
+	}
+	if changed {
+		p.rebuildRing()
+	}
+}
+
+func (p *Pool) ping(peer *Peer) bool {
+	resp, err := p.httpClient.Get("http://" + peer.Addr + "/cluster/health")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,83 @@
+// Package cluster lets a fleet of ratelimiter instances share GCRA state for
+// the same client by consistent-hashing each client ID to a single owning
+// peer, and forwarding Check requests from non-owners to that peer.
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// replicasPerPeer is the number of virtual nodes placed on the ring per
+// real peer, smoothing the distribution of keys across owners.
+const replicasPerPeer = 160
+
+// Ring is a consistent-hash ring mapping client keys to owning Peers.
+type Ring struct {
+	mu       sync.RWMutex
+	hashes   []uint32
+	hashPeer map[uint32]*Peer
+	peers    map[string]*Peer
+}
+
+// NewRing creates an empty Ring.
+func NewRing() *Ring {
+	return &Ring{
+		hashPeer: make(map[uint32]*Peer),
+		peers:    make(map[string]*Peer),
+	}
+}
+
+// Set replaces the ring's peer set with peers, rebuilding virtual nodes.
+func (r *Ring) Set(peers []*Peer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hashes = r.hashes[:0]
+	r.hashPeer = make(map[uint32]*Peer)
+	r.peers = make(map[string]*Peer, len(peers))
+
+	for _, p := range peers {
+		r.peers[p.ID] = p
+		for i := 0; i < replicasPerPeer; i++ {
+			h := hashKey(p.ID + "#" + strconv.Itoa(i))
+			r.hashes = append(r.hashes, h)
+			r.hashPeer[h] = p
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Owner returns the Peer that authoritatively owns key, or nil if the ring
+// has no peers.
+func (r *Ring) Owner(key string) *Peer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.hashes) == 0 {
+		return nil
+	}
+
+	h := hashKey(key)
+	idx := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if idx == len(r.hashes) {
+		idx = 0
+	}
+	return r.hashPeer[r.hashes[idx]]
+}
+
+// Peer returns the peer with the given ID, if present.
+func (r *Ring) Peer(id string) (*Peer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.peers[id]
+	return p, ok
+}
+
+func hashKey(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRing_OwnerIsStableAndCoversAllPeers(t *testing.T) {
+	r := NewRing()
+	peers := []*Peer{{ID: "a", Addr: "a:1"}, {ID: "b", Addr: "b:1"}, {ID: "c", Addr: "c:1"}}
+	r.Set(peers)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key := "client" + strconv.Itoa(i)
+		owner := r.Owner(key)
+		if owner == nil {
+			t.Fatalf("expected an owner for key %q", key)
+		}
+		if owner != r.Owner(key) {
+			t.Fatalf("expected Owner(%q) to be stable across calls", key)
+		}
+		seen[owner.ID] = true
+	}
+	if len(seen) != len(peers) {
+		t.Fatalf("expected every peer to own at least one key, got owners %v", seen)
+	}
+}
+
+func TestRing_OwnerNilWithNoPeers(t *testing.T) {
+	r := NewRing()
+	if owner := r.Owner("anything"); owner != nil {
+		t.Fatalf("expected nil owner on an empty ring, got %+v", owner)
+	}
+}
+
+func TestRing_Peer(t *testing.T) {
+	r := NewRing()
+	r.Set([]*Peer{{ID: "a", Addr: "a:1"}})
+
+	if _, ok := r.Peer("a"); !ok {
+		t.Fatal("expected Peer(\"a\") to be found")
+	}
+	if _, ok := r.Peer("missing"); ok {
+		t.Fatal("expected Peer(\"missing\") to be absent")
+	}
+}
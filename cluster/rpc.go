@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CheckRequest is the wire representation of a single GCRA decision request
+// forwarded to a key's owning peer.
+type CheckRequest struct {
+	Key          string `json:"key"`
+	Rate         int    `json:"rate"`
+	PeriodMillis int64  `json:"period_ms"`
+	Burst        int    `json:"burst"`
+}
+
+// CheckResponse is the wire representation of the owning peer's decision.
+type CheckResponse struct {
+	Limited          bool   `json:"limited"`
+	Limit            int    `json:"limit"`
+	Remaining        int    `json:"remaining"`
+	RetryAfterMillis int64  `json:"retry_after_ms"`
+	ResetAfterMillis int64  `json:"reset_after_ms"`
+	Error            string `json:"error,omitempty"`
+}
+
+// RateLimitFunc evaluates a single request locally; it is how Server calls
+// back into the process's own Store without this package importing it.
+type RateLimitFunc func(key string, rate, burst int, period time.Duration) (limited bool, limit, remaining int, retryAfter, resetAfter time.Duration, err error)
+
+// Server exposes this node's RateLimitFunc over HTTP so that non-owner peers
+// can forward Check and GetPeerRateLimit requests to it.
+type Server struct {
+	RateLimit RateLimitFunc
+}
+
+// ServeHTTP implements http.Handler, routing /cluster/check,
+// /cluster/batch, and /cluster/health.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cluster/health":
+		w.WriteHeader(http.StatusOK)
+	case "/cluster/check":
+		s.serveCheck(w, r)
+	case "/cluster/batch":
+		s.serveBatch(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveCheck(w http.ResponseWriter, r *http.Request) {
+	var req CheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, s.evaluate(req))
+}
+
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	var reqs []CheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resps := make([]CheckResponse, len(reqs))
+	for i, req := range reqs {
+		resps[i] = s.evaluate(req)
+	}
+	writeJSON(w, resps)
+}
+
+func (s *Server) evaluate(req CheckRequest) CheckResponse {
+	limited, limit, remaining, retryAfter, resetAfter, err := s.RateLimit(
+		req.Key, req.Rate, req.Burst, time.Duration(req.PeriodMillis)*time.Millisecond)
+	if err != nil {
+		return CheckResponse{Error: err.Error()}
+	}
+	return CheckResponse{
+		Limited:          limited,
+		Limit:            limit,
+		Remaining:        remaining,
+		RetryAfterMillis: retryAfter.Milliseconds(),
+		ResetAfterMillis: resetAfter.Milliseconds(),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Client forwards Check and GetPeerRateLimit RPCs to owning peers.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a Client with the given per-request timeout.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{httpClient: &http.Client{Timeout: timeout}}
+}
+
+// Check forwards a single rate-limit decision to peer.
+func (c *Client) Check(peer *Peer, req CheckRequest) (CheckResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return CheckResponse{}, err
+	}
+
+	resp, err := c.httpClient.Post("http://"+peer.Addr+"/cluster/check", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return CheckResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var out CheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return CheckResponse{}, err
+	}
+	if out.Error != "" {
+		return CheckResponse{}, fmt.Errorf("cluster: peer %s: %s", peer.ID, out.Error)
+	}
+	return out, nil
+}
+
+// GetPeerRateLimit forwards a batch of rate-limit decisions to peer in a
+// single round trip, so many keys owned by the same peer can be checked at
+// once.
+func (c *Client) GetPeerRateLimit(peer *Peer, reqs []CheckRequest) ([]CheckResponse, error) {
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Post("http://"+peer.Addr+"/cluster/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out []CheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,128 @@
+// cluster_integration.go
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/JessicaBlau/Ratelimiter/cluster"
+)
+
+const (
+	peerHealthCheckInterval = 5 * time.Second
+	peerHealthCheckTimeout  = 2 * time.Second
+	peerRPCTimeout          = 500 * time.Millisecond
+	decisionCacheTTL        = 50 * time.Millisecond
+	peerDiscoveryInterval   = 30 * time.Second
+)
+
+// ClusterConfig configures peer-to-peer distribution of GCRA state across a
+// fleet of ratelimiter instances, consistent-hashing each client key to a
+// single owning peer.
+type ClusterConfig struct {
+	SelfID string               `json:"SelfID"`
+	Peers  []cluster.PeerConfig `json:"Peers"`
+}
+
+// clusterRouter forwards a RateLimit decision to whichever peer owns key,
+// per a consistent-hash Ring built from ClusterConfig.Peers, falling back to
+// a local decision when this instance is the owner or the owner can't be
+// reached.
+type clusterRouter struct {
+	selfID     string
+	pool       *cluster.Pool
+	client     *cluster.Client
+	cache      *cluster.DecisionCache
+	discoverer cluster.Discoverer
+}
+
+func newClusterRouter(cfg ClusterConfig) *clusterRouter {
+	discoverer := cluster.StaticDiscoverer{Peers: cfg.Peers}
+	peers, err := discoverer.Discover()
+	if err != nil {
+		peers = nil
+	}
+
+	c := &clusterRouter{
+		selfID:     cfg.SelfID,
+		pool:       cluster.NewPool(peers, peerHealthCheckInterval, peerHealthCheckTimeout),
+		client:     cluster.NewClient(peerRPCTimeout),
+		cache:      cluster.NewDecisionCache(decisionCacheTTL),
+		discoverer: discoverer,
+	}
+	go c.discoveryLoop()
+	return c
+}
+
+// discoveryLoop periodically re-resolves c.discoverer and hands the result
+// to c.pool, so peers can be added or removed (e.g. a DNSSRVDiscoverer or
+// K8sEndpointsWatcher reacting to a changed endpoint set) without a restart.
+func (c *clusterRouter) discoveryLoop() {
+	ticker := time.NewTicker(peerDiscoveryInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		peers, err := c.discoverer.Discover()
+		if err != nil {
+			continue
+		}
+		c.pool.SetPeers(peers)
+	}
+}
+
+// RateLimit evaluates key locally if this instance owns it (or no peer
+// does); otherwise it forwards the decision to the owning peer. Only
+// "limited" verdicts are cached: replaying a stale rejection is still safe
+// (the request stays rejected), but replaying a stale "allowed" verdict
+// would let a client behind a non-owner node send unbounded requests for as
+// long as the cache entry lives, since nothing would ever debit it again.
+func (c *clusterRouter) RateLimit(key string, quota RateQuota, local Store) (bool, RateLimitResult, error) {
+	owner := c.pool.Ring().Owner(key)
+	if owner == nil || owner.ID == c.selfID {
+		return local.RateLimit(key, quota)
+	}
+
+	if resp, ok := c.cache.Get(key); ok {
+		limited, result := fromCheckResponse(resp)
+		return limited, result, nil
+	}
+
+	req := cluster.CheckRequest{
+		Key:          key,
+		Rate:         quota.Rate,
+		PeriodMillis: quota.Period.Milliseconds(),
+		Burst:        quota.Burst,
+	}
+	resp, err := c.client.Check(owner, req)
+	if err != nil {
+		// The owner is unreachable; degrade to a local decision rather than
+		// failing the request outright.
+		return local.RateLimit(key, quota)
+	}
+
+	if resp.Limited {
+		c.cache.Set(key, resp)
+	}
+	limited, result := fromCheckResponse(resp)
+	return limited, result, nil
+}
+
+func fromCheckResponse(resp cluster.CheckResponse) (bool, RateLimitResult) {
+	return resp.Limited, RateLimitResult{
+		Limit:      resp.Limit,
+		Remaining:  resp.Remaining,
+		RetryAfter: time.Duration(resp.RetryAfterMillis) * time.Millisecond,
+		ResetAfter: time.Duration(resp.ResetAfterMillis) * time.Millisecond,
+	}
+}
+
+// handler serves this instance's side of the cluster RPC protocol -
+// incoming Check/batch requests forwarded by non-owner peers - backed by
+// local.
+func (c *clusterRouter) handler(local Store) http.Handler {
+	return &cluster.Server{
+		RateLimit: func(key string, rate, burst int, period time.Duration) (bool, int, int, time.Duration, time.Duration, error) {
+			limited, result, err := local.RateLimit(key, RateQuota{Rate: rate, Period: period, Burst: burst})
+			return limited, result.Limit, result.Remaining, result.RetryAfter, result.ResetAfter, err
+		},
+	}
+}
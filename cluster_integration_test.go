@@ -0,0 +1,89 @@
+// cluster_integration_test.go
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JessicaBlau/Ratelimiter/cluster"
+)
+
+// newTestClusterRouter stands up an httptest.Server running a cluster.Server
+// backed by store, and returns a clusterRouter whose single peer is that
+// server - so every key in the test is forwarded, never served locally.
+func newTestClusterRouter(store Store, calls *int64) (*clusterRouter, func()) {
+	srv := &cluster.Server{
+		RateLimit: func(key string, rate, burst int, period time.Duration) (bool, int, int, time.Duration, time.Duration, error) {
+			if calls != nil {
+				atomic.AddInt64(calls, 1)
+			}
+			limited, result, err := store.RateLimit(key, RateQuota{Rate: rate, Period: period, Burst: burst})
+			return limited, result.Limit, result.Remaining, result.RetryAfter, result.ResetAfter, err
+		},
+	}
+	ts := httptest.NewServer(srv)
+
+	peer := &cluster.Peer{ID: "owner", Addr: strings.TrimPrefix(ts.URL, "http://")}
+	pool := cluster.NewPool([]*cluster.Peer{peer}, time.Hour, time.Second)
+
+	router := &clusterRouter{
+		selfID: "self",
+		pool:   pool,
+		client: cluster.NewClient(time.Second),
+		cache:  cluster.NewDecisionCache(50 * time.Millisecond),
+	}
+	return router, ts.Close
+}
+
+func TestClusterRouter_RateLimit_DoesNotReplayStaleAllowedDecision(t *testing.T) {
+	router, closeServer := newTestClusterRouter(NewMemoryStore(10), nil)
+	defer closeServer()
+
+	quota := RateQuota{Rate: 1, Period: time.Second, Burst: 1}
+	local := NewMemoryStore(10)
+
+	limited, _, err := router.RateLimit("k1", quota, local)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limited {
+		t.Fatal("expected the first request to be allowed")
+	}
+
+	limited, _, err = router.RateLimit("k1", quota, local)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !limited {
+		t.Fatal("expected the second request to hit the owner's real GCRA state and be limited, not replay the cached allowed verdict")
+	}
+}
+
+func TestClusterRouter_RateLimit_CachesOnlyLimitedDecisions(t *testing.T) {
+	var calls int64
+	router, closeServer := newTestClusterRouter(NewMemoryStore(10), &calls)
+	defer closeServer()
+
+	quota := RateQuota{Rate: 1, Period: time.Second, Burst: 1}
+	local := NewMemoryStore(10)
+
+	if limited, _, err := router.RateLimit("k2", quota, local); err != nil || limited {
+		t.Fatalf("expected first request allowed, got limited=%v err=%v", limited, err)
+	}
+	if limited, _, err := router.RateLimit("k2", quota, local); err != nil || !limited {
+		t.Fatalf("expected second request limited, got limited=%v err=%v", limited, err)
+	}
+	if got := atomic.LoadInt64(&calls); got != 2 {
+		t.Fatalf("expected 2 owner round-trips so far, got %d", got)
+	}
+
+	if limited, _, err := router.RateLimit("k2", quota, local); err != nil || !limited {
+		t.Fatalf("expected third request to replay the cached limited decision, got limited=%v err=%v", limited, err)
+	}
+	if got := atomic.LoadInt64(&calls); got != 2 {
+		t.Fatalf("expected the cached limited decision to serve the third request without another owner round-trip, got %d calls", got)
+	}
+}
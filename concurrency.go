@@ -0,0 +1,244 @@
+// concurrency.go
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// priorityHeader carries the caller's priority class; requests without it
+// are treated as batch and served only once interactive demand is met.
+const priorityHeader = "X-Priority"
+
+// Priority classifies a request for queue ordering under a ConcurrencyLimiter.
+type Priority int
+
+const (
+	// PriorityBatch is the default: queued requests of this priority are
+	// only dequeued once there is no PriorityInteractive request waiting.
+	PriorityBatch Priority = iota
+	// PriorityInteractive jumps ahead of any queued PriorityBatch request.
+	PriorityInteractive
+)
+
+func parsePriority(r *http.Request) Priority {
+	if r.Header.Get(priorityHeader) == "interactive" {
+		return PriorityInteractive
+	}
+	return PriorityBatch
+}
+
+// ConcurrencyConfig configures a ConcurrencyLimiter.
+type ConcurrencyConfig struct {
+	MaxConcurrent      int            `json:"MaxConcurrent"`      // global cap on in-flight requests
+	MaxQueueDepth      int            `json:"MaxQueueDepth"`      // bounded backlog beyond MaxConcurrent
+	QueueTimeoutMillis int            `json:"QueueTimeoutMillis"` // how long a queued request waits before 503
+	PerClientMax       map[string]int `json:"PerClientMax"`
+}
+
+func (c ConcurrencyConfig) queueTimeout() time.Duration {
+	return time.Duration(c.QueueTimeoutMillis) * time.Millisecond
+}
+
+// limiterCore is a single concurrency gate: up to max requests may hold a
+// ticket at once, with callers beyond that bound joining a priority queue
+// (interactive ahead of batch) up to maxQueueDepth deep.
+type limiterCore struct {
+	max           int
+	maxQueueDepth int
+
+	mu          sync.Mutex
+	inFlight    int
+	interactive []chan struct{}
+	batch       []chan struct{}
+	queueDepth  int32 // atomic, mirrors len(interactive)+len(batch) for lock-free reads
+}
+
+func newLimiterCore(max, maxQueueDepth int) *limiterCore {
+	return &limiterCore{max: max, maxQueueDepth: maxQueueDepth}
+}
+
+// acquire blocks until a slot is available, the queue is full (returns
+// false immediately), or timeout elapses while queued (returns false).
+func (c *limiterCore) acquire(priority Priority, timeout time.Duration) bool {
+	c.mu.Lock()
+	if c.inFlight < c.max {
+		c.inFlight++
+		c.mu.Unlock()
+		return true
+	}
+	if int(atomic.LoadInt32(&c.queueDepth)) >= c.maxQueueDepth {
+		c.mu.Unlock()
+		return false
+	}
+
+	ticket := make(chan struct{}, 1)
+	if priority == PriorityInteractive {
+		c.interactive = append(c.interactive, ticket)
+	} else {
+		c.batch = append(c.batch, ticket)
+	}
+	atomic.AddInt32(&c.queueDepth, 1)
+	c.mu.Unlock()
+
+	select {
+	case <-ticket:
+		return true
+	case <-time.After(timeout):
+		if c.dequeue(ticket) {
+			return false
+		}
+		// dequeue didn't find ticket because release already handed it the
+		// slot (under c.mu, before our timeout fired) and counted it as
+		// in-flight. Take that slot instead of reporting false, or it would
+		// leak forever since the caller only releases a slot it believes it
+		// acquired.
+		<-ticket
+		return true
+	}
+}
+
+// release hands the freed slot directly to the next queued ticket
+// (interactive first), or returns it to the pool if nothing is waiting.
+func (c *limiterCore) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var next chan struct{}
+	if len(c.interactive) > 0 {
+		next = c.interactive[0]
+		c.interactive = c.interactive[1:]
+	} else if len(c.batch) > 0 {
+		next = c.batch[0]
+		c.batch = c.batch[1:]
+	}
+
+	if next == nil {
+		c.inFlight--
+		return
+	}
+	atomic.AddInt32(&c.queueDepth, -1)
+	next <- struct{}{}
+}
+
+// dequeue removes ticket from whichever queue it is still sitting in, e.g.
+// after it timed out without being handed a slot, and reports whether it
+// found it there. It returns false if ticket already left the queue via
+// release - meaning release has already handed it a slot, which the caller
+// must then account for instead of discarding.
+func (c *limiterCore) dequeue(ticket chan struct{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, t := range c.interactive {
+		if t == ticket {
+			c.interactive = append(c.interactive[:i], c.interactive[i+1:]...)
+			atomic.AddInt32(&c.queueDepth, -1)
+			return true
+		}
+	}
+	for i, t := range c.batch {
+		if t == ticket {
+			c.batch = append(c.batch[:i], c.batch[i+1:]...)
+			atomic.AddInt32(&c.queueDepth, -1)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *limiterCore) concurrency() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight
+}
+
+func (c *limiterCore) queued() int {
+	return int(atomic.LoadInt32(&c.queueDepth))
+}
+
+// ConcurrencyLimiter caps the number of in-flight requests independent of
+// the per-second GCRA rate, queueing overflow up to a bounded backlog so the
+// service degrades gracefully rather than shedding load outright. It can
+// enforce both a global cap and, optionally, a tighter cap per client.
+type ConcurrencyLimiter struct {
+	global       *limiterCore
+	queueTimeout time.Duration
+
+	perClientMax map[string]int
+	mu           sync.Mutex
+	perClient    map[string]*limiterCore
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter from cfg.
+func NewConcurrencyLimiter(cfg ConcurrencyConfig) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		global:       newLimiterCore(cfg.MaxConcurrent, cfg.MaxQueueDepth),
+		queueTimeout: cfg.queueTimeout(),
+		perClientMax: cfg.PerClientMax,
+		perClient:    make(map[string]*limiterCore),
+	}
+}
+
+func (cl *ConcurrencyLimiter) clientCore(clientID string) *limiterCore {
+	max, ok := cl.perClientMax[clientID]
+	if !ok {
+		return nil
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	core, ok := cl.perClient[clientID]
+	if !ok {
+		core = newLimiterCore(max, cl.global.maxQueueDepth)
+		cl.perClient[clientID] = core
+	}
+	return core
+}
+
+// Wrap returns next wrapped in the concurrency gate: requests beyond the
+// configured cap(s) queue by Priority, and requests that exceed
+// QueueTimeout waiting receive a 503 with Retry-After.
+func (cl *ConcurrencyLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority := parsePriority(r)
+		clientID := r.Header.Get(clientIDHeader)
+
+		client := cl.clientCore(clientID)
+		if client != nil {
+			if !client.acquire(priority, cl.queueTimeout) {
+				cl.reject(w)
+				return
+			}
+			defer client.release()
+		}
+
+		if !cl.global.acquire(priority, cl.queueTimeout) {
+			cl.reject(w)
+			return
+		}
+		defer cl.global.release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cl *ConcurrencyLimiter) reject(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(cl.queueTimeout.Seconds()+1)))
+	http.Error(w, "Server overloaded. Too many in-flight requests.", http.StatusServiceUnavailable)
+}
+
+// Concurrency returns the current number of in-flight requests holding the
+// global slot.
+func (cl *ConcurrencyLimiter) Concurrency() int {
+	return cl.global.concurrency()
+}
+
+// QueueDepth returns the current number of requests queued for the global
+// slot.
+func (cl *ConcurrencyLimiter) QueueDepth() int {
+	return cl.global.queued()
+}
@@ -0,0 +1,60 @@
+// concurrency_test.go
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterCore_TimeoutWithNoHandoffReportsDenied(t *testing.T) {
+	core := newLimiterCore(1, 1)
+	if !core.acquire(PriorityBatch, time.Second) {
+		t.Fatal("expected the first acquire to succeed")
+	}
+
+	if core.acquire(PriorityBatch, 10*time.Millisecond) {
+		t.Fatal("expected the second acquire to time out and be denied")
+	}
+	if got := core.concurrency(); got != 1 {
+		t.Fatalf("expected concurrency to stay at 1 after a plain timeout, got %d", got)
+	}
+	if got := core.queued(); got != 0 {
+		t.Fatalf("expected the timed-out ticket to be dequeued, got queued=%d", got)
+	}
+}
+
+// TestLimiterCore_HandoffRacingTimeoutDoesNotLeakSlot reproduces release()
+// handing a queued ticket its slot in the same instant the ticket's timeout
+// fires. dequeue must report it found nothing (release already removed it
+// from the queue), and acquire must treat that as "acquired" rather than
+// discarding the handed-off slot - otherwise concurrency permanently shrinks
+// by one every time this race is lost.
+func TestLimiterCore_HandoffRacingTimeoutDoesNotLeakSlot(t *testing.T) {
+	core := newLimiterCore(1, 1)
+	if !core.acquire(PriorityBatch, time.Second) {
+		t.Fatal("expected the first acquire to succeed")
+	}
+
+	ticket := make(chan struct{}, 1)
+	core.mu.Lock()
+	core.batch = append(core.batch, ticket)
+	atomic.AddInt32(&core.queueDepth, 1)
+	core.mu.Unlock()
+
+	// Simulate release() handing the slot to ticket at the same instant the
+	// caller's select sees its timeout fire, before it calls dequeue.
+	core.release()
+
+	if core.dequeue(ticket) {
+		t.Fatal("expected dequeue to report the ticket had already been handed off")
+	}
+	select {
+	case <-ticket:
+	default:
+		t.Fatal("expected release to have sent on ticket before dequeue ran")
+	}
+	if got := core.concurrency(); got != 1 {
+		t.Fatalf("expected the handed-off slot to still count as in-flight, got concurrency=%d", got)
+	}
+}
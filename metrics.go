@@ -0,0 +1,238 @@
+// metrics.go
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxTrackedMetricsClients bounds the number of distinct clients Metrics
+// retains counters for, evicting the least recently observed client once
+// exceeded - client is attacker-controlled (the X-Client-ID header), so
+// without a bound requestsTotal/tokensRemaining would grow forever.
+const maxTrackedMetricsClients = 100000
+
+// requestKey labels a single ratelimiter_requests_total observation.
+type requestKey struct {
+	client   string
+	endpoint string
+	decision string // "allowed" or "limited"
+}
+
+// Metrics aggregates per-client/per-endpoint counters and decision latency
+// for the /metrics endpoint, in Prometheus text exposition format.
+type Metrics struct {
+	maxClients int
+
+	mu              sync.Mutex
+	requestsTotal   map[requestKey]int64
+	tokensRemaining map[string]int // client -> Remaining as of its last decision
+	latencyCount    map[string]int64
+	latencySum      map[string]float64 // endpoint -> summed decision latency, seconds
+
+	// order/elemOf/keysByClient bound requestsTotal/tokensRemaining by
+	// client, LRU-evicting the least recently observed one once
+	// maxClients is exceeded.
+	order        *list.List
+	elemOf       map[string]*list.Element
+	keysByClient map[string]map[requestKey]struct{}
+
+	gaugeMu sync.Mutex
+	gauges  map[string]func() float64 // name -> current value, e.g. tracked client count
+}
+
+// NewMetrics creates an empty Metrics registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		maxClients:      maxTrackedMetricsClients,
+		requestsTotal:   make(map[requestKey]int64),
+		tokensRemaining: make(map[string]int),
+		latencyCount:    make(map[string]int64),
+		latencySum:      make(map[string]float64),
+		order:           list.New(),
+		elemOf:          make(map[string]*list.Element),
+		keysByClient:    make(map[string]map[requestKey]struct{}),
+		gauges:          make(map[string]func() float64),
+	}
+}
+
+// ObserveDecision records one rate-limit decision: which client and
+// endpoint it was for, whether it was limited, how many cells remained
+// afterward, and how long the decision took to compute.
+func (m *Metrics) ObserveDecision(client, endpoint string, limited bool, remaining int, latency time.Duration) {
+	decision := "allowed"
+	if limited {
+		decision = "limited"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := requestKey{client, endpoint, decision}
+	m.requestsTotal[key]++
+	m.tokensRemaining[client] = remaining
+	m.latencyCount[endpoint]++
+	m.latencySum[endpoint] += latency.Seconds()
+
+	if _, ok := m.keysByClient[client]; !ok {
+		m.keysByClient[client] = make(map[requestKey]struct{})
+	}
+	m.keysByClient[client][key] = struct{}{}
+	m.touch(client)
+	m.evictIfNeeded()
+}
+
+// touch marks client as most-recently-observed, inserting it into the LRU
+// list if it isn't already tracked. Caller must hold m.mu.
+func (m *Metrics) touch(client string) {
+	if elem, ok := m.elemOf[client]; ok {
+		m.order.MoveToFront(elem)
+		return
+	}
+	m.elemOf[client] = m.order.PushFront(client)
+}
+
+// evictIfNeeded drops the least recently observed client's counters once
+// more than maxClients are tracked. Caller must hold m.mu.
+func (m *Metrics) evictIfNeeded() {
+	if m.maxClients <= 0 {
+		return
+	}
+	for m.order.Len() > m.maxClients {
+		oldest := m.order.Back()
+		if oldest == nil {
+			return
+		}
+		client := oldest.Value.(string)
+		m.order.Remove(oldest)
+		delete(m.elemOf, client)
+		delete(m.tokensRemaining, client)
+		for key := range m.keysByClient[client] {
+			delete(m.requestsTotal, key)
+		}
+		delete(m.keysByClient, client)
+	}
+}
+
+// SetGauge registers (or replaces) a gauge reported under name, computed
+// on demand from fn whenever /metrics is scraped.
+func (m *Metrics) SetGauge(name string, fn func() float64) {
+	m.gaugeMu.Lock()
+	defer m.gaugeMu.Unlock()
+	m.gauges[name] = fn
+}
+
+// ServeHTTP implements the /metrics endpoint in Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP ratelimiter_requests_total Total requests by client, endpoint, and decision.")
+	fmt.Fprintln(w, "# TYPE ratelimiter_requests_total counter")
+	for _, k := range sortedRequestKeys(m.requestsTotal) {
+		fmt.Fprintf(w, "ratelimiter_requests_total{client=%q,endpoint=%q,decision=%q} %d\n",
+			k.client, k.endpoint, k.decision, m.requestsTotal[k])
+	}
+
+	fmt.Fprintln(w, "# HELP ratelimiter_tokens_remaining GCRA cells remaining for the client as of its last decision.")
+	fmt.Fprintln(w, "# TYPE ratelimiter_tokens_remaining gauge")
+	for _, client := range sortedStringKeys(m.tokensRemaining) {
+		fmt.Fprintf(w, "ratelimiter_tokens_remaining{client=%q} %d\n", client, m.tokensRemaining[client])
+	}
+
+	fmt.Fprintln(w, "# HELP ratelimiter_decision_latency_seconds Time spent evaluating a rate limit decision.")
+	fmt.Fprintln(w, "# TYPE ratelimiter_decision_latency_seconds summary")
+	for _, endpoint := range sortedLatencyKeys(m.latencyCount) {
+		fmt.Fprintf(w, "ratelimiter_decision_latency_seconds_sum{endpoint=%q} %f\n", endpoint, m.latencySum[endpoint])
+		fmt.Fprintf(w, "ratelimiter_decision_latency_seconds_count{endpoint=%q} %d\n", endpoint, m.latencyCount[endpoint])
+	}
+
+	m.gaugeMu.Lock()
+	defer m.gaugeMu.Unlock()
+	for _, name := range sortedGaugeKeys(m.gauges) {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(w, "%s %f\n", name, m.gauges[name]())
+	}
+}
+
+func sortedRequestKeys(m map[requestKey]int64) []requestKey {
+	keys := make([]requestKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].client != keys[j].client {
+			return keys[i].client < keys[j].client
+		}
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].decision < keys[j].decision
+	})
+	return keys
+}
+
+func sortedStringKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedLatencyKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedGaugeKeys(m map[string]func() float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rejectionLog is the structured JSON line emitted for every rejected
+// request, so an operator can see why a client was blocked and how close
+// others are to their limit without re-deriving it from RequestMax/TokensPerSec
+// in config.json.
+type rejectionLog struct {
+	ClientID   string  `json:"client_id"`
+	Endpoint   string  `json:"endpoint"`
+	Rule       string  `json:"rule,omitempty"`
+	Remaining  int     `json:"remaining"`
+	RetryAfter float64 `json:"retry_after_seconds"`
+}
+
+// logRejection writes a rejectionLog as one JSON line via the standard log
+// package.
+func logRejection(clientID, endpoint, rule string, result RateLimitResult) {
+	entry := rejectionLog{
+		ClientID:   clientID,
+		Endpoint:   endpoint,
+		Rule:       rule,
+		Remaining:  result.Remaining,
+		RetryAfter: result.RetryAfter.Seconds(),
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("ratelimiter: failed to marshal rejection log: %v", err)
+		return
+	}
+	log.Println(string(line))
+}
@@ -0,0 +1,61 @@
+// metrics_test.go
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics_ObserveDecisionAndServeHTTP(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveDecision("client1", "/limit", false, 4, 10*time.Millisecond)
+	m.ObserveDecision("client1", "/limit", true, 0, 5*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	if want := `ratelimiter_requests_total{client="client1",endpoint="/limit",decision="allowed"} 1`; !strings.Contains(body, want) {
+		t.Errorf("expected exposition to contain %q, got:\n%s", want, body)
+	}
+	if want := `ratelimiter_tokens_remaining{client="client1"} 0`; !strings.Contains(body, want) {
+		t.Errorf("expected exposition to contain %q, got:\n%s", want, body)
+	}
+}
+
+func TestMetrics_BoundsTrackedClients(t *testing.T) {
+	m := NewMetrics()
+	m.maxClients = 2
+
+	m.ObserveDecision("client1", "/limit", false, 1, time.Millisecond)
+	m.ObserveDecision("client2", "/limit", false, 1, time.Millisecond)
+	m.ObserveDecision("client3", "/limit", false, 1, time.Millisecond)
+
+	if _, ok := m.tokensRemaining["client1"]; ok {
+		t.Error("expected client1 to have been evicted once maxClients was exceeded")
+	}
+	if len(m.tokensRemaining) != 2 {
+		t.Errorf("expected exactly 2 clients tracked, got %d", len(m.tokensRemaining))
+	}
+	for key := range m.requestsTotal {
+		if key.client == "client1" {
+			t.Errorf("expected client1's requestsTotal entries to be evicted, found %+v", key)
+		}
+	}
+}
+
+func TestMetrics_ObserveDecision_ManyClientsStaysBounded(t *testing.T) {
+	m := NewMetrics()
+	m.maxClients = 10
+
+	for i := 0; i < 100; i++ {
+		m.ObserveDecision(fmt.Sprintf("client%d", i), "/limit", false, 1, time.Millisecond)
+	}
+
+	if len(m.tokensRemaining) != 10 {
+		t.Errorf("expected tokensRemaining bounded to 10 entries, got %d", len(m.tokensRemaining))
+	}
+}
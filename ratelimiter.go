@@ -2,55 +2,180 @@
 package main
 
 import (
+	"container/list"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
-
-	"github.com/juju/ratelimit"
 )
 
 const (
 	clientIDHeader    = "X-Client-ID" // Custom header name for clientID
-	requestLimitReset = time.Second   // Request limit reset interval (1 second)
 	configFile        = "config.json" // Configuration file path
+	maxTrackedKeys    = 100000        // Bound on the number of keys MemoryStore retains
+	maxTrackedClients = 100000        // Bound on the number of clients RateLimiter.clients retains
+	defaultRate       = 5             // Default sustained requests/sec if not configured
+	defaultBurst      = 10            // Default burst size if not configured
 )
 
-// Client represents a single client with its request limit and request count
+// Client represents a single client and the quota it is governed by. Matcher
+// is non-nil when the client's config defines named Rules; in that case
+// Quota is ignored in favor of per-rule evaluation.
 type Client struct {
-	ID            string
-	RequestMax    int
-	Requests      int
-	RequestMutex  sync.Mutex
-	LastResetTime time.Time
-	RateLimiter   *ratelimit.Bucket // Custom rate limiter for each client
+	ID      string
+	Quota   RateQuota
+	Matcher *RuleMatcher
 }
 
 // Configuration represents the configuration structure
 type Configuration struct {
-	Clients []ClientConfig `json:"clients"`
+	Clients     []ClientConfig     `json:"clients"`
+	Cluster     *ClusterConfig     `json:"cluster,omitempty"`
+	Concurrency *ConcurrencyConfig `json:"concurrency,omitempty"`
+	Bandwidth   *BandwidthConfig   `json:"bandwidth,omitempty"`
 }
 
 // ClientConfig represents the client configuration structure
 type ClientConfig struct {
 	ID           string `json:"ID"`
-	RequestMax   int    `json:"RequestMax"`
-	TokensPerSec int    `json:"TokensPerSec"`
+	RequestMax   int    `json:"RequestMax"`   // burst size
+	TokensPerSec int    `json:"TokensPerSec"` // sustained rate
+
+	// Rules, when non-empty, lets a client be governed by several named
+	// policies simultaneously (matched by method/path/header/query); a
+	// request is rejected if any matching rule's RateSet is exhausted. When
+	// empty, the client falls back to the single RequestMax/TokensPerSec
+	// quota above.
+	Rules []RuleConfig `json:"Rules,omitempty"`
+
+	// BytesPerSec caps this client's connections under ListenAndServeSlow to
+	// that many bytes/sec of Read and Write; 0 means use the server's
+	// default, MaxRate means unlimited.
+	BytesPerSec int `json:"BytesPerSec,omitempty"`
+}
+
+// quota converts a ClientConfig into the RateQuota the Store operates on.
+func (c ClientConfig) quota() RateQuota {
+	rate := c.TokensPerSec
+	if rate == 0 {
+		rate = defaultRate
+	}
+	burst := c.RequestMax
+	if burst == 0 {
+		burst = defaultBurst
+	}
+	return RateQuota{Rate: rate, Period: time.Second, Burst: burst}
+}
+
+// newClient builds the runtime Client for a ClientConfig, compiling its
+// Rules (if any) into a RuleMatcher once up front.
+func newClient(cc ClientConfig) *Client {
+	client := &Client{ID: cc.ID, Quota: cc.quota()}
+	if len(cc.Rules) > 0 {
+		client.Matcher = NewRuleMatcher(cc.Rules)
+	}
+	return client
 }
 
-// RateLimiter is the main rate limiter service
+// RateLimiter is the main rate limiter service. It resolves each client ID to
+// a RateQuota and delegates the actual GCRA decision to a Store, so the same
+// RateLimiter works whether backed by an in-memory MemoryStore or a shared
+// RedisStore.
 type RateLimiter struct {
-	clients map[string]*Client
+	store      Store
+	cluster    *clusterRouter // nil unless the configuration has a "cluster" section
+	extractor  Extractor      // derives the per-rule key; defaults to clientExtractor
+	metrics    *Metrics
+	maxClients int
+
 	lock    sync.Mutex
+	clients map[string]*Client
+	order   *list.List
+	elemOf  map[string]*list.Element
 }
 
-// NewRateLimiter creates a new RateLimiter
+// NewRateLimiter creates a new RateLimiter backed by an in-memory Store,
+// loading client quotas (and, if present, a ClusterConfig) from configFile.
 func NewRateLimiter() *RateLimiter {
-	return &RateLimiter{
-		clients: make(map[string]*Client),
+	config, err := LoadConfig()
+	if err != nil {
+		config = &Configuration{}
 	}
+	return NewRateLimiterWithConfig(*config)
+}
+
+// NewRateLimiterWithConfig creates a new RateLimiter backed by an in-memory
+// Store, using the given configuration instead of reading configFile. If
+// config.Cluster is set, keys are distributed across its peers instead of
+// being served entirely from the local Store.
+func NewRateLimiterWithConfig(config Configuration) *RateLimiter {
+	return newRateLimiter(NewMemoryStore(maxTrackedKeys), config)
+}
+
+// NewRateLimiterWithStore creates a new RateLimiter backed by store, e.g. a
+// RedisStore shared across a fleet of instances.
+func NewRateLimiterWithStore(store Store, config Configuration) *RateLimiter {
+	return newRateLimiter(store, config)
+}
+
+func newRateLimiter(store Store, config Configuration) *RateLimiter {
+	rl := &RateLimiter{
+		store:      store,
+		extractor:  clientExtractor{},
+		metrics:    NewMetrics(),
+		maxClients: maxTrackedClients,
+		clients:    make(map[string]*Client),
+		order:      list.New(),
+		elemOf:     make(map[string]*list.Element),
+	}
+	if config.Cluster != nil {
+		rl.cluster = newClusterRouter(*config.Cluster)
+	}
+	for _, cc := range config.Clients {
+		rl.clients[cc.ID] = newClient(cc)
+		rl.touch(cc.ID)
+	}
+	rl.metrics.SetGauge("ratelimiter_tracked_clients", func() float64 {
+		rl.lock.Lock()
+		defer rl.lock.Unlock()
+		return float64(len(rl.clients))
+	})
+	if ms, ok := store.(*MemoryStore); ok {
+		rl.metrics.SetGauge("ratelimiter_tracked_keys", func() float64 { return float64(ms.Len()) })
+	}
+	return rl
+}
+
+// Reload replaces rl's client quotas and rules with those in config,
+// without disturbing in-flight GCRA state in the Store. Safe to call
+// concurrently with request handling.
+func (rl *RateLimiter) Reload(config Configuration) {
+	clients := make(map[string]*Client, len(config.Clients))
+	order := list.New()
+	elemOf := make(map[string]*list.Element, len(config.Clients))
+	for _, cc := range config.Clients {
+		clients[cc.ID] = newClient(cc)
+		elemOf[cc.ID] = order.PushFront(cc.ID)
+	}
+
+	rl.lock.Lock()
+	rl.clients = clients
+	rl.order = order
+	rl.elemOf = elemOf
+	rl.lock.Unlock()
+}
+
+// rateLimit evaluates key under quota, routing through the cluster if one is
+// configured, or the local Store otherwise.
+func (rl *RateLimiter) rateLimit(key string, quota RateQuota) (bool, RateLimitResult, error) {
+	if rl.cluster != nil {
+		return rl.cluster.RateLimit(key, quota, rl.store)
+	}
+	return rl.store.RateLimit(key, quota)
 }
 
 // LoadConfig loads the configuration from the configFile
@@ -69,54 +194,63 @@ func LoadConfig() (*Configuration, error) {
 	return &config, nil
 }
 
-// getClient retrieves the client based on its unique ID
+// getClient retrieves the client based on its unique ID, registering it with
+// a default quota the first time it is seen. clientID comes straight from the
+// caller-supplied X-Client-ID header, so rl.clients is LRU-bounded at
+// maxClients to keep an attacker cycling through IDs from growing it without
+// limit.
 func (rl *RateLimiter) getClient(clientID string) *Client {
 	rl.lock.Lock()
 	defer rl.lock.Unlock()
 
 	client, ok := rl.clients[clientID]
 	if !ok {
-		config, err := LoadConfig()
-		if err != nil {
-			// Set a default request limit if the config file cannot be loaded
-			config = &Configuration{
-				Clients: []ClientConfig{
-					{ID: clientID, RequestMax: 10, TokensPerSec: 5}, // Default request limit and tokens per second (adjust as desired)
-				},
-			}
-		}
-
-		var requestMax, tokensPerSec int
-		for _, clientConfig := range config.Clients {
-			if clientConfig.ID == clientID {
-				requestMax = clientConfig.RequestMax
-				tokensPerSec = clientConfig.TokensPerSec
-				break
-			}
-		}
+		client = newClient(ClientConfig{ID: clientID})
+		rl.clients[clientID] = client
+	}
+	rl.touch(clientID)
+	rl.evictIfNeeded()
 
-		if requestMax == 0 {
-			// Set a default request limit if the client is not found in the config
-			requestMax = 10 // Default request limit per second (adjust as desired)
-		}
+	return client
+}
 
-		if tokensPerSec == 0 {
-			// Set a default tokens per second if not found in the config
-			tokensPerSec = 5 // Default tokens per second (adjust as desired)
-		}
+// touch marks clientID as most-recently-used, inserting it into the LRU list
+// if it isn't already tracked. Caller must hold rl.lock.
+func (rl *RateLimiter) touch(clientID string) {
+	if elem, ok := rl.elemOf[clientID]; ok {
+		rl.order.MoveToFront(elem)
+		return
+	}
+	rl.elemOf[clientID] = rl.order.PushFront(clientID)
+}
 
-		client = &Client{
-			ID:            clientID,
-			RequestMax:    requestMax,
-			Requests:      0,
-			RequestMutex:  sync.Mutex{},
-			LastResetTime: time.Now(),
-			RateLimiter:   ratelimit.NewBucket(time.Second/time.Duration(tokensPerSec), int64(tokensPerSec)),
+// evictIfNeeded removes the least recently used client once rl.clients holds
+// more than maxClients entries. Caller must hold rl.lock.
+func (rl *RateLimiter) evictIfNeeded() {
+	if rl.maxClients <= 0 {
+		return
+	}
+	for rl.order.Len() > rl.maxClients {
+		oldest := rl.order.Back()
+		if oldest == nil {
+			return
 		}
-		rl.clients[clientID] = client
+		clientID := oldest.Value.(string)
+		rl.order.Remove(oldest)
+		delete(rl.elemOf, clientID)
+		delete(rl.clients, clientID)
 	}
+}
 
-	return client
+// writeRateLimitHeaders sets the conventional X-RateLimit-* headers (and
+// Retry-After when the request was limited) from a RateLimitResult.
+func writeRateLimitHeaders(w http.ResponseWriter, result RateLimitResult) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(result.ResetAfter.Seconds())))
+	if result.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(result.RetryAfter.Seconds()+1)))
+	}
 }
 
 // handleLimit handles the "/limit" endpoint
@@ -129,29 +263,35 @@ func (rl *RateLimiter) handleLimit(w http.ResponseWriter, r *http.Request) {
 
 	client := rl.getClient(clientID)
 
-	// Acquire the request mutex to ensure thread safety
-	client.RequestMutex.Lock()
-	defer client.RequestMutex.Unlock()
-
-	// Reset request count if it has been 1 second since the last reset
-	currentTime := time.Now()
-	if currentTime.Sub(client.LastResetTime) >= requestLimitReset {
-		client.Requests = 0
-		client.LastResetTime = currentTime
+	start := time.Now()
+	limited, rule, result, err := rl.evaluate(client, clientID, r)
+	rl.metrics.ObserveDecision(clientID, "/limit", limited, result.Remaining, time.Since(start))
+	if err != nil {
+		http.Error(w, "Internal rate limiter error", http.StatusInternalServerError)
+		return
 	}
 
-	// Check if the client has exceeded the request limit
-	if client.Requests >= client.RequestMax {
-		http.Error(w, "Request blocked. Too many requests.", http.StatusBadRequest)
+	writeRateLimitHeaders(w, result)
+	if limited {
+		logRejection(clientID, "/limit", rule, result)
+		http.Error(w, "Request blocked. Too many requests.", http.StatusTooManyRequests)
 		return
 	}
 
-	// Increment the request count
-	client.Requests++
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// evaluate checks r against client's configured Rules, if any, or else its
+// single RequestMax/TokensPerSec quota. The returned string names the rule
+// responsible for the decision, or "default" when no Rules are configured.
+func (rl *RateLimiter) evaluate(client *Client, clientID string, r *http.Request) (bool, string, RateLimitResult, error) {
+	if client.Matcher != nil {
+		return client.Matcher.Evaluate(rl.rateLimit, rl.extractor, clientID, r)
+	}
+	limited, result, err := rl.rateLimit(clientID, client.Quota)
+	return limited, "default", result, err
+}
+
 // handleCustom handles the "/custom" endpoint with custom rate limiter logic
 func (rl *RateLimiter) handleCustom(w http.ResponseWriter, r *http.Request) {
 	clientID := r.Header.Get(clientIDHeader)
@@ -162,40 +302,80 @@ func (rl *RateLimiter) handleCustom(w http.ResponseWriter, r *http.Request) {
 
 	client := rl.getClient(clientID)
 
-	// Acquire the request mutex to ensure thread safety
-	client.RequestMutex.Lock()
-	defer client.RequestMutex.Unlock()
-
-	// Check if the client's token bucket allows the request
-	if client.RateLimiter.TakeAvailable(1) == 0 {
-		http.Error(w, "Request blocked. No more tokens.", http.StatusBadRequest)
-		return
+	var limited bool
+	var rule string
+	var result RateLimitResult
+	var err error
+
+	start := time.Now()
+	if client.Matcher != nil {
+		limited, rule, result, err = client.Matcher.Evaluate(rl.rateLimit, rl.extractor, clientID, r)
+	} else {
+		// Key the custom endpoint separately from "/limit" so the two
+		// handlers don't share a single bucket for the same client.
+		rule = "default"
+		limited, result, err = rl.rateLimit(clientID+":custom", client.Quota)
 	}
-
-	// Reset request count if it has been 1 second since the last reset
-	currentTime := time.Now()
-	if currentTime.Sub(client.LastResetTime) >= requestLimitReset {
-		client.Requests = 0
-		client.LastResetTime = currentTime
+	rl.metrics.ObserveDecision(clientID, "/custom", limited, result.Remaining, time.Since(start))
+	if err != nil {
+		http.Error(w, "Internal rate limiter error", http.StatusInternalServerError)
+		return
 	}
 
-	// Use the rate limiter to check if the request is allowed
-	if client.Requests >= client.RequestMax {
-		http.Error(w, "Request blocked. Too many custom requests.", http.StatusBadRequest)
+	writeRateLimitHeaders(w, result)
+	if limited {
+		logRejection(clientID, "/custom", rule, result)
+		http.Error(w, "Request blocked. No more tokens.", http.StatusTooManyRequests)
 		return
 	}
 
-	client.Requests++
-
 	w.Write([]byte("OK"))
 }
 
 func main() {
 	rateLimiter := NewRateLimiter()
+	config, _ := LoadConfig()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/limit", rateLimiter.handleLimit)
+	mux.HandleFunc("/custom", rateLimiter.handleCustom)
+	mux.Handle("/metrics", rateLimiter.metrics)
+	if rateLimiter.cluster != nil {
+		mux.Handle("/cluster/", rateLimiter.cluster.handler(rateLimiter.store))
+	}
+
+	var handler http.Handler = mux
+	if config != nil && config.Concurrency != nil {
+		concurrency := NewConcurrencyLimiter(*config.Concurrency)
+		rateLimiter.metrics.SetGauge("ratelimiter_concurrency_inflight", func() float64 {
+			return float64(concurrency.Concurrency())
+		})
+		rateLimiter.metrics.SetGauge("ratelimiter_concurrency_queued", func() float64 {
+			return float64(concurrency.QueueDepth())
+		})
+		handler = concurrency.Wrap(mux)
+	}
 
-	http.HandleFunc("/limit", rateLimiter.handleLimit)
-	http.HandleFunc("/custom", rateLimiter.handleCustom)
+	go watchConfigFile(rateLimiter, nil)
 
 	fmt.Println("Rate Limiter is running on http://localhost:8080/limit")
-	http.ListenAndServe(":8080", nil)
+	if config != nil && config.Bandwidth != nil {
+		inner, err := net.Listen("tcp", ":8080")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		slow := NewSlowListener(inner, config.Bandwidth.DefaultBytesPerSec)
+		rateLimiter.metrics.SetGauge("ratelimiter_bandwidth_bytes_read", func() float64 {
+			read, _ := slow.Counters()
+			return float64(read)
+		})
+		rateLimiter.metrics.SetGauge("ratelimiter_bandwidth_bytes_written", func() float64 {
+			_, written := slow.Counters()
+			return float64(written)
+		})
+		ServeSlow(slow, handler)
+		return
+	}
+	http.ListenAndServe(":8080", handler)
 }
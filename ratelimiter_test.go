@@ -14,6 +14,20 @@ import (
 	"time"
 )
 
+// burstRefillDelay returns how long to wait for every client's burst in
+// config to fully refill under GCRA, with a small safety margin.
+func burstRefillDelay(config *Configuration) time.Duration {
+	var longest time.Duration
+	for _, cc := range config.Clients {
+		q := cc.quota()
+		refill := time.Duration(q.Burst) * q.emissionInterval()
+		if refill > longest {
+			longest = refill
+		}
+	}
+	return longest + 200*time.Millisecond
+}
+
 func TestRateLimiter(t *testing.T) {
 	rateLimiter := NewRateLimiter()
 
@@ -47,13 +61,13 @@ func TestRateLimiter(t *testing.T) {
 
 		rateLimiter.handleLimit(rec, req)
 
-		if rec.Code != http.StatusBadRequest {
-			t.Errorf("Expected HTTP status 400 for client %s, got: %d", clientID, rec.Code)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected HTTP status 429 for client %s, got: %d", clientID, rec.Code)
 		}
 	}
 
-	// Wait for a second to reset the request count
-	time.Sleep(1 * time.Second)
+	// Wait long enough for every client's burst to fully refill under GCRA.
+	time.Sleep(burstRefillDelay(config))
 
 	// Now, the requests for each client should be allowed again based on the configuration
 	for _, clientConfig := range config.Clients {
@@ -124,8 +138,8 @@ func TestRateLimiter_Concurrency(t *testing.T) {
 
 		rateLimiter.handleLimit(rec, req)
 
-		if rec.Code != http.StatusBadRequest {
-			t.Errorf("Expected HTTP status 400 for client %s, got: %d", clientID, rec.Code)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected HTTP status 429 for client %s, got: %d", clientID, rec.Code)
 		}
 	}
 }
@@ -172,12 +186,13 @@ func TestRateLimiter_HandleCustom(t *testing.T) {
 			t.Fatalf("failed to send request: %v", err)
 		}
 	}
-	if resp.StatusCode != http.StatusBadRequest {
-		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status code %d, got %d", http.StatusTooManyRequests, resp.StatusCode)
 	}
 
-	// Test case 4: Wait for the rate limiter to reset and allow more requests
-	time.Sleep(requestLimitReset)
+	// Test case 4: Wait for the default client's burst to fully refill
+	// (defaultBurst/defaultRate seconds), then allow more requests.
+	time.Sleep(defaultBurst * time.Second / defaultRate)
 
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
@@ -302,8 +317,8 @@ func runTestFail(t *testing.T, ts *httptest.Server, config Configuration, numReq
 				// and allow subsequent requests to be processed.
 				resp.Body.Close()
 
-				// If the response status code is http.StatusBadRequest, it means the request was blocked by the rate limiter
-				if resp.StatusCode == http.StatusBadRequest && j >= allowedRate {
+				// If the response status code is http.StatusTooManyRequests, it means the request was blocked by the rate limiter
+				if resp.StatusCode == http.StatusTooManyRequests && j >= allowedRate {
 					flag = true
 					t.Logf("%s: Request blocked", clientID)
 				}
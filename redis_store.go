@@ -0,0 +1,92 @@
+// redis_store.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript implements the same GCRA decision as MemoryStore.RateLimit, but
+// atomically inside Redis so that many ratelimiter instances sharing the
+// same Redis can agree on a single "tat" per key. It GETs the stored tat (if
+// any), computes the new tat and allow-at time, and either leaves the key
+// untouched (limited) or SETs it with a TTL of burst*interval (allowed).
+//
+// KEYS[1] = the rate limit key
+// ARGV[1] = interval nanoseconds (T)
+// ARGV[2] = burst
+// ARGV[3] = now nanoseconds
+var gcraScript = redis.NewScript(`
+local tat = tonumber(redis.call("GET", KEYS[1]))
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+if tat == nil or tat < now then
+	tat = now
+end
+
+local newTat = tat + interval
+local allowAt = newTat - (burst * interval)
+
+if now < allowAt then
+	return {1, allowAt - now, tat - now}
+end
+
+local ttl = math.ceil((burst * interval) / 1e6)
+redis.call("SET", KEYS[1], newTat, "PX", ttl)
+return {0, 0, newTat - now}
+`)
+
+// RedisStore is a Store backed by Redis, allowing a set of ratelimiter
+// instances to share GCRA state for the same key.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore that namespaces all keys under prefix
+// (e.g. "ratelimiter:") to avoid colliding with other users of client.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// RateLimit implements Store by running gcraScript against Redis.
+func (s *RedisStore) RateLimit(key string, quota RateQuota) (bool, RateLimitResult, error) {
+	interval := quota.emissionInterval()
+	if interval <= 0 {
+		return true, RateLimitResult{}, fmt.Errorf("redis store: invalid quota %+v", quota)
+	}
+
+	ctx := context.Background()
+	now := time.Now().UnixNano()
+
+	res, err := gcraScript.Run(ctx, s.client, []string{s.prefix + key},
+		interval.Nanoseconds(), quota.Burst, now).Result()
+	if err != nil {
+		return true, RateLimitResult{}, err
+	}
+
+	vals := res.([]interface{})
+	limited := vals[0].(int64) == 1
+	retryAfter := time.Duration(vals[1].(int64))
+	resetAfter := time.Duration(vals[2].(int64))
+
+	remaining := 0
+	if !limited {
+		remaining = quota.Burst - int(resetAfter/interval)
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+
+	return limited, RateLimitResult{
+		Limit:      quota.Burst,
+		Remaining:  remaining,
+		RetryAfter: retryAfter,
+		ResetAfter: resetAfter,
+	}, nil
+}
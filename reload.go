@@ -0,0 +1,62 @@
+// reload.go
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// configPollInterval is how often watchConfigFile checks configFile's mtime
+// for changes, as a portable fallback for platforms where SIGHUP isn't a
+// natural fit (e.g. under a process supervisor that doesn't forward it).
+const configPollInterval = 5 * time.Second
+
+// watchConfigFile reloads rl's rules and client quotas whenever the process
+// receives SIGHUP, or whenever configFile's mtime changes, so operators can
+// edit config.json without restarting the service. It blocks until done is
+// closed.
+func watchConfigFile(rl *RateLimiter, done <-chan struct{}) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	lastMod := configFileModTime()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-sighup:
+			reloadConfig(rl)
+		case <-ticker.C:
+			if mod := configFileModTime(); !mod.IsZero() && mod.After(lastMod) {
+				lastMod = mod
+				reloadConfig(rl)
+			}
+		}
+	}
+}
+
+func configFileModTime() time.Time {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func reloadConfig(rl *RateLimiter) {
+	config, err := LoadConfig()
+	if err != nil {
+		log.Printf("ratelimiter: config reload failed, keeping previous config: %v", err)
+		return
+	}
+	rl.Reload(*config)
+	log.Printf("ratelimiter: reloaded configuration from %s", configFile)
+}
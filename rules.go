@@ -0,0 +1,218 @@
+// rules.go
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateSet is an ordered set of quotas that all apply simultaneously to a
+// matched request - e.g. "100 req/sec burst 20" together with "10000
+// req/hour". A request is allowed only if every quota in the set allows it.
+type RateSet []RateQuota
+
+// RateQuotaConfig is the config-file representation of a single RateQuota.
+type RateQuotaConfig struct {
+	PeriodSeconds int `json:"PeriodSeconds"` // the period Average applies over
+	Average       int `json:"Average"`       // sustained requests allowed per period
+	Burst         int `json:"Burst"`         // instantaneous burst size
+}
+
+func (c RateQuotaConfig) quota() RateQuota {
+	period := time.Duration(c.PeriodSeconds) * time.Second
+	if period <= 0 {
+		period = time.Second
+	}
+	burst := c.Burst
+	if burst == 0 {
+		burst = c.Average
+	}
+	return RateQuota{Rate: c.Average, Period: period, Burst: burst}
+}
+
+// RuleConfig is the config-file representation of a Rule: which requests it
+// applies to, and the RateSet that governs them.
+type RuleConfig struct {
+	Name    string            `json:"Name"`
+	Method  string            `json:"Method"`  // HTTP method to match, "" or "*" matches any
+	Path    string            `json:"Path"`    // glob pattern matched against the request path
+	Headers map[string]string `json:"Headers"` // header name -> required exact value
+	Query   map[string]string `json:"Query"`   // query param -> required exact value
+	Quotas  []RateQuotaConfig `json:"Quotas"`
+}
+
+// Extractor derives the key used to track a rule's GCRA state from the
+// already-resolved client ID and the incoming request, e.g. to fold the
+// route into the key so "/read" and "/write" are limited independently.
+type Extractor interface {
+	Extract(clientID string, r *http.Request) string
+}
+
+// ExtractorFunc adapts a function to an Extractor.
+type ExtractorFunc func(clientID string, r *http.Request) string
+
+// Extract implements Extractor.
+func (f ExtractorFunc) Extract(clientID string, r *http.Request) string { return f(clientID, r) }
+
+// clientExtractor is the default Extractor: key purely by client ID, so a
+// rule's quota is shared across every route it matches.
+type clientExtractor struct{}
+
+func (clientExtractor) Extract(clientID string, r *http.Request) string { return clientID }
+
+// rule is a RuleConfig compiled for request-time matching: its path glob is
+// pre-compiled to a regexp so evaluating a rule against a request never
+// re-parses the pattern.
+type rule struct {
+	name    string
+	method  string
+	path    *regexp.Regexp
+	headers map[string]string
+	query   map[string]string
+	quotas  RateSet
+}
+
+func compileRule(rc RuleConfig) (rule, error) {
+	re, err := globToRegexp(rc.Path)
+	if err != nil {
+		return rule{}, err
+	}
+
+	quotas := make(RateSet, 0, len(rc.Quotas))
+	for _, qc := range rc.Quotas {
+		quotas = append(quotas, qc.quota())
+	}
+
+	return rule{
+		name:    rc.Name,
+		method:  strings.ToUpper(rc.Method),
+		path:    re,
+		headers: rc.Headers,
+		query:   rc.Query,
+		quotas:  quotas,
+	}, nil
+}
+
+// matches reports whether r satisfies the rule's method, path, header, and
+// query predicates.
+func (ru rule) matches(r *http.Request) bool {
+	if ru.method != "" && ru.method != "*" && ru.method != strings.ToUpper(r.Method) {
+		return false
+	}
+	if ru.path != nil && !ru.path.MatchString(r.URL.Path) {
+		return false
+	}
+	for name, want := range ru.headers {
+		if r.Header.Get(name) != want {
+			return false
+		}
+	}
+	for name, want := range ru.query {
+		if r.URL.Query().Get(name) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// globToRegexp compiles a simple shell-style glob (where "*" matches any run
+// of path characters) into an anchored regexp, once, at config load time.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	if glob == "" {
+		return nil, nil
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, part := range strings.Split(glob, "*") {
+		b.WriteString(regexp.QuoteMeta(part))
+		b.WriteString(".*")
+	}
+	pattern := strings.TrimSuffix(b.String(), ".*") + "$"
+	return regexp.Compile(pattern)
+}
+
+// RuleMatcher holds a client's compiled rules and evaluates all of them that
+// match an incoming request.
+type RuleMatcher struct {
+	rules []rule
+}
+
+// NewRuleMatcher compiles configs into a RuleMatcher. Invalid glob patterns
+// are skipped rather than failing config load outright.
+func NewRuleMatcher(configs []RuleConfig) *RuleMatcher {
+	m := &RuleMatcher{}
+	for _, rc := range configs {
+		if ru, err := compileRule(rc); err == nil {
+			m.rules = append(m.rules, ru)
+		}
+	}
+	return m
+}
+
+// rateLimitFunc evaluates a single key+quota decision, e.g. RateLimiter.rateLimit.
+type rateLimitFunc func(key string, quota RateQuota) (bool, RateLimitResult, error)
+
+// Evaluate runs every rule matching r through rateLimit, keyed by
+// extractor.Extract(clientID, r)+":"+rule name (+quota index). It returns
+// whether the request is limited by at least one rule, the name of the rule
+// responsible for the single most restrictive decision, and that decision's
+// RateLimitResult for reporting in response headers and logs. Once any quota
+// has rejected the request, remaining quotas are skipped entirely rather
+// than charged, so a client already being blocked by one rule can't burn
+// down another, unrelated rule's budget.
+func (m *RuleMatcher) Evaluate(rateLimit rateLimitFunc, extractor Extractor, clientID string, r *http.Request) (bool, string, RateLimitResult, error) {
+	limitedAny := false
+	var worstRule string
+	var worst RateLimitResult
+	haveWorst := false
+
+	for _, ru := range m.rules {
+		if limitedAny {
+			break
+		}
+		if !ru.matches(r) {
+			continue
+		}
+		base := extractor.Extract(clientID, r) + ":" + ru.name
+
+		for i, quota := range ru.quotas {
+			key := base
+			if len(ru.quotas) > 1 {
+				key = base + ":" + strconv.Itoa(i)
+			}
+
+			limited, result, err := rateLimit(key, quota)
+			if err != nil {
+				return true, ru.name, RateLimitResult{}, err
+			}
+			if !haveWorst || worseResult(limited, result, limitedAny, worst) {
+				worst = result
+				worstRule = ru.name
+				haveWorst = true
+			}
+			if limited {
+				limitedAny = true
+				break
+			}
+		}
+	}
+
+	return limitedAny, worstRule, worst, nil
+}
+
+// worseResult reports whether (limited, result) is a more restrictive
+// decision than the current worst. A limited decision always outranks an
+// allowed one; among limited decisions the larger RetryAfter wins; among
+// allowed decisions the smaller Remaining wins.
+func worseResult(limited bool, result RateLimitResult, worstLimited bool, worst RateLimitResult) bool {
+	if limited != worstLimited {
+		return limited
+	}
+	if limited {
+		return result.RetryAfter > worst.RetryAfter
+	}
+	return result.Remaining < worst.Remaining
+}
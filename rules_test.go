@@ -0,0 +1,92 @@
+// rules_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRuleMatcher_HeadersReflectRealQuotaWhenAllowed(t *testing.T) {
+	matcher := NewRuleMatcher([]RuleConfig{
+		{
+			Name:   "reads",
+			Method: "GET",
+			Quotas: []RateQuotaConfig{{PeriodSeconds: 1, Average: 5, Burst: 5}},
+		},
+	})
+
+	store := NewMemoryStore(maxTrackedKeys)
+	rateLimit := func(key string, quota RateQuota) (bool, RateLimitResult, error) {
+		return store.RateLimit(key, quota)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/read", nil)
+	limited, rule, result, err := matcher.Evaluate(rateLimit, clientExtractor{}, "client1", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limited {
+		t.Fatalf("expected the first request to be allowed")
+	}
+	if rule != "reads" {
+		t.Errorf("expected rule %q, got %q", "reads", rule)
+	}
+	if result.Limit != 5 || result.Remaining != 4 {
+		t.Errorf("expected headers to reflect the reads quota (limit=5, remaining=4), got %+v", result)
+	}
+}
+
+func TestRuleMatcher_StopsChargingAfterRejection(t *testing.T) {
+	matcher := NewRuleMatcher([]RuleConfig{
+		{
+			Name:   "tight",
+			Method: "GET",
+			Quotas: []RateQuotaConfig{{PeriodSeconds: 1, Average: 1, Burst: 1}},
+		},
+		{
+			Name:   "loose",
+			Method: "GET",
+			Quotas: []RateQuotaConfig{{PeriodSeconds: 1, Average: 100, Burst: 100}},
+		},
+	})
+
+	store := NewMemoryStore(maxTrackedKeys)
+	// Freeze the clock so the loose quota's remaining count shows exactly
+	// how many times it was charged.
+	now := time.Now()
+	store.nowFunc = func() time.Time { return now }
+	rateLimit := func(key string, quota RateQuota) (bool, RateLimitResult, error) {
+		return store.RateLimit(key, quota)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/read", nil)
+
+	// Exhaust the "tight" rule's single-request burst.
+	if limited, _, _, err := matcher.Evaluate(rateLimit, clientExtractor{}, "client1", req); err != nil || limited {
+		t.Fatalf("expected the first request to be allowed, limited=%v err=%v", limited, err)
+	}
+
+	// The second request should be rejected by "tight" without ever
+	// touching "loose"'s budget.
+	limited, rule, _, err := matcher.Evaluate(rateLimit, clientExtractor{}, "client1", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !limited || rule != "tight" {
+		t.Fatalf("expected rejection by %q, got limited=%v rule=%q", "tight", limited, rule)
+	}
+
+	looseLimited, looseResult, err := store.RateLimit("client1:loose", RateQuota{Rate: 100, Period: time.Second, Burst: 100})
+	if err != nil {
+		t.Fatalf("unexpected error checking loose quota: %v", err)
+	}
+	if looseLimited {
+		t.Fatalf("loose quota should not have been charged by the rejected request")
+	}
+	// Charged once by the allowed request and once by this check: 100-2.
+	if looseResult.Remaining != 98 {
+		t.Fatalf("loose quota should not have been charged by the rejected request, got remaining=%d, want 98", looseResult.Remaining)
+	}
+}
@@ -0,0 +1,155 @@
+// store.go
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateQuota describes the shape of a GCRA limit: burst cells spaced at
+// period/rate apart, i.e. the classic "average rate with burst" quota.
+type RateQuota struct {
+	Rate   int           // sustained requests allowed per Period
+	Period time.Duration // the period over which Rate applies
+	Burst  int           // number of cells that may be consumed instantaneously
+}
+
+// emissionInterval returns T, the GCRA emission interval: the time that must
+// elapse between cells at the configured sustained rate.
+func (q RateQuota) emissionInterval() time.Duration {
+	if q.Rate <= 0 {
+		return 0
+	}
+	return q.Period / time.Duration(q.Rate)
+}
+
+// RateLimitResult carries the outcome of a RateLimit call, independent of
+// which Store produced it.
+type RateLimitResult struct {
+	Limit      int           // the Burst size the decision was evaluated against
+	Remaining  int           // cells left before the next request would be limited
+	RetryAfter time.Duration // how long until a limited request would succeed; 0 if not limited
+	ResetAfter time.Duration // how long until the bucket is fully drained back to Limit
+}
+
+// Store is implemented by GCRA backends that can track a per-key "tat"
+// (theoretical arrival time) and decide whether a request at the current
+// instant should be allowed. Implementations must be safe for concurrent use.
+type Store interface {
+	// RateLimit evaluates one request against key under quota, returning
+	// whether it is limited along with the resulting RateLimitResult.
+	RateLimit(key string, quota RateQuota) (limited bool, result RateLimitResult, err error)
+}
+
+// MemoryStore is an in-process Store backed by an LRU-bounded map of GCRA
+// state. It is suitable for a single instance; use RedisStore when limits
+// must be shared across a fleet.
+type MemoryStore struct {
+	maxKeys int
+
+	mu      sync.Mutex
+	tat     map[string]time.Time
+	order   *list.List
+	elemOf  map[string]*list.Element
+	nowFunc func() time.Time
+}
+
+// NewMemoryStore creates a MemoryStore that tracks at most maxKeys entries,
+// evicting the least recently used key once the bound is reached.
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	return &MemoryStore{
+		maxKeys: maxKeys,
+		tat:     make(map[string]time.Time),
+		order:   list.New(),
+		elemOf:  make(map[string]*list.Element),
+		nowFunc: time.Now,
+	}
+}
+
+// RateLimit implements Store using the GCRA algorithm described in
+// https://en.wikipedia.org/wiki/Generic_cell_rate_algorithm.
+func (s *MemoryStore) RateLimit(key string, quota RateQuota) (bool, RateLimitResult, error) {
+	interval := quota.emissionInterval()
+	if interval <= 0 {
+		return true, RateLimitResult{}, fmt.Errorf("store: invalid quota %+v", quota)
+	}
+	burst := time.Duration(quota.Burst) * interval
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.nowFunc()
+	tat := now
+	if t, ok := s.tat[key]; ok {
+		tat = t
+	}
+	if now.After(tat) {
+		tat = now
+	}
+
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-burst)
+
+	if now.Before(allowAt) {
+		retryAfter := allowAt.Sub(now)
+		s.touch(key)
+		return true, RateLimitResult{
+			Limit:      quota.Burst,
+			Remaining:  0,
+			RetryAfter: retryAfter,
+			ResetAfter: tat.Sub(now),
+		}, nil
+	}
+
+	s.tat[key] = newTat
+	s.touch(key)
+	s.evictIfNeeded()
+
+	remaining := int(newTat.Sub(now) / interval)
+	if remaining > quota.Burst {
+		remaining = quota.Burst
+	}
+	return false, RateLimitResult{
+		Limit:      quota.Burst,
+		Remaining:  quota.Burst - remaining,
+		RetryAfter: 0,
+		ResetAfter: newTat.Sub(now),
+	}, nil
+}
+
+// Len returns the number of keys currently tracked, for exposing as a gauge.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tat)
+}
+
+// touch marks key as most-recently-used, inserting it into the LRU list if
+// it isn't already tracked. Caller must hold s.mu.
+func (s *MemoryStore) touch(key string) {
+	if elem, ok := s.elemOf[key]; ok {
+		s.order.MoveToFront(elem)
+		return
+	}
+	s.elemOf[key] = s.order.PushFront(key)
+}
+
+// evictIfNeeded removes the least recently used key once the store holds
+// more than maxKeys entries. Caller must hold s.mu.
+func (s *MemoryStore) evictIfNeeded() {
+	if s.maxKeys <= 0 {
+		return
+	}
+	for s.order.Len() > s.maxKeys {
+		oldest := s.order.Back()
+		if oldest == nil {
+			return
+		}
+		key := oldest.Value.(string)
+		s.order.Remove(oldest)
+		delete(s.elemOf, key)
+		delete(s.tat, key)
+	}
+}